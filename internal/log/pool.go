@@ -0,0 +1,110 @@
+package log
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// maxPooledSize caps how large a buffer the pool will reuse. Records bigger
+// than this bypass the pool and are allocated directly, so one
+// pathologically large record can't leave an oversized buffer sitting
+// around for every future Read to inherit.
+const maxPooledSize = 1 << 20
+
+// bufferPool hands out reusable byte slices so store.Read doesn't allocate
+// a fresh slice on every call. Buffers are bucketed by power-of-two size,
+// the same size-class scheme Go's own allocator uses, starting at
+// lenWidth (the smallest thing we ever read, the length prefix itself) so
+// a Read for a small record never hands back a slice sized for a much
+// larger one.
+type bufferPool struct {
+	buckets []sync.Pool
+	shift   int // bit shift of the smallest bucket
+}
+
+func newBufferPool() *bufferPool {
+	minShift := bits.Len(uint(lenWidth - 1))
+	maxShift := bits.Len(uint(maxPooledSize - 1))
+	p := &bufferPool{
+		buckets: make([]sync.Pool, maxShift-minShift+1),
+		shift:   minShift,
+	}
+	for i := range p.buckets {
+		size := 1 << (minShift + i)
+		p.buckets[i].New = func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		}
+	}
+	return p
+}
+
+// bucket returns the index of the bucket sized to hold n bytes, and false
+// if n exceeds maxPooledSize and should bypass the pool entirely.
+func (p *bufferPool) bucket(n uint64) (int, bool) {
+	if n > maxPooledSize {
+		return 0, false
+	}
+	s := p.shift
+	if n > 1 {
+		if l := bits.Len64(n - 1); l > s {
+			s = l
+		}
+	}
+	return s - p.shift, true
+}
+
+// get returns a pointer to a buffer of length n, reused from the pool when
+// n fits within maxPooledSize and freshly allocated otherwise.
+//
+// get and put deal in *[]byte, not []byte, and a caller must put back the
+// exact pointer it got: a []byte is a three-word header, too wide to fit
+// in the single word an interface{} can hold inline, so handing sync.Pool
+// a []byte directly boxes a fresh copy of that header on the heap on
+// every single Put (staticcheck SA6002) -- the pool would spend an
+// allocation putting a buffer back just to save one taking it out.
+// Threading the same *[]byte through Get and Put instead reuses one
+// already-boxed header indefinitely, so steady-state Get/Put is alloc-free
+// once the pool is warm.
+func (p *bufferPool) get(n uint64) *[]byte {
+	idx, ok := p.bucket(n)
+	if !ok {
+		buf := make([]byte, n)
+		return &buf
+	}
+	bufp := p.buckets[idx].Get().(*[]byte)
+	*bufp = (*bufp)[:n]
+	return bufp
+}
+
+// put returns a buffer pointer acquired from get back to its bucket, keyed
+// off its capacity so a slice that was re-sliced smaller still lands in
+// the right bucket. Buffers larger than maxPooledSize are dropped instead
+// of pooled.
+func (p *bufferPool) put(bufp *[]byte) {
+	idx, ok := p.bucket(uint64(cap(*bufp)))
+	if !ok {
+		return
+	}
+	*bufp = (*bufp)[:cap(*bufp)]
+	p.buckets[idx].Put(bufp)
+}
+
+var pool = newBufferPool()
+
+// Get returns a pointer to a buffer of length n from the same shared pool
+// store.Read draws from, for callers outside this package that want to
+// write into pooled memory instead of allocating their own and never
+// returning it. It returns *[]byte rather than []byte so the pointer a
+// later Release call passes back is the very one Get handed out -- see
+// bufferPool.get.
+func Get(n uint64) *[]byte {
+	return pool.get(n)
+}
+
+// Release returns a buffer pointer previously returned by Get or
+// store.Read to the shared buffer pool so a later caller can reuse it
+// instead of leaving it for the GC to collect.
+func Release(buf *[]byte) {
+	pool.put(buf)
+}
@@ -3,8 +3,11 @@ package log
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
+	"io"
 	"os"
 	"sync"
+	"time"
 )
 
 var (
@@ -15,15 +18,78 @@ const (
 	lenWidth = 8 // number of bytes used to store the record's length
 )
 
+// ErrStoreFull is returned by Append when the record, with its length
+// prefix, would take the store past StoreConfig.MaxBytes; the record is
+// not written. The segment layer treats it as the signal to seal
+// this store and rotate onto a new one.
+var ErrStoreFull = errors.New("store: max bytes exceeded")
+
+// ErrCorruptRecord is returned by Read and ReadInto when the record at the
+// requested position doesn't fully exist on disk -- e.g. a crash that
+// landed between writing a record's length prefix and writing the record
+// itself -- so callers can tell that apart from an ordinary I/O error
+// instead of getting a short read or a raw io.EOF back.
+var ErrCorruptRecord = errors.New("store: corrupt record")
+
+// SyncPolicy controls when a store fsyncs its file to disk, trading write
+// latency against how much data a crash can lose after Append has already
+// returned success -- a flushed bufio.Writer only guarantees the kernel has
+// the bytes, not that they've reached the disk.
+type SyncPolicy int
+
+const (
+	// SyncNone never fsyncs on its own; only an explicit Sync call or
+	// Close does. This is the zero value, so a zero-value StoreConfig
+	// behaves the way store always used to.
+	SyncNone SyncPolicy = iota
+	// SyncOnFlush fsyncs whenever a read (Read, ReadInto, ReadAt,
+	// ReadRangeAt, SectionReader) flushes the bufio.Writer, and on Close,
+	// rather than waiting on a separate trigger. The flushes bufio.Writer
+	// makes by itself when its buffer fills during Append are not followed
+	// by an fsync.
+	SyncOnFlush
+	// SyncEveryN fsyncs after every StoreConfig.SyncEveryN Appends.
+	SyncEveryN
+	// SyncInterval fsyncs on a fixed timer, run by a background
+	// goroutine, independent of how often Append is called.
+	SyncInterval
+)
+
+// StoreConfig bounds how large a single store's file may grow and how
+// aggressively it fsyncs.
+type StoreConfig struct {
+	// MaxBytes caps the store's size: Append returns ErrStoreFull for any
+	// record whose length prefix and body would take the store past it.
+	// Zero means unbounded.
+	MaxBytes uint64
+
+	SyncPolicy SyncPolicy
+
+	// SyncEveryN is the Append count between fsyncs when SyncPolicy is
+	// SyncEveryN.
+	SyncEveryN int
+
+	// SyncInterval is the fsync period when SyncPolicy is SyncInterval.
+	SyncInterval time.Duration
+}
+
 type store struct {
 	*os.File
-	mu   sync.Mutex
-	buf  *bufio.Writer
-	size uint64
+	mu     sync.Mutex
+	buf    *bufio.Writer
+	size   uint64
+	config StoreConfig
+
+	writesSinceSync int
+
+	stopSync chan struct{}
+	syncDone chan struct{}
 }
 
-// This method creates a Store for the given file
-func newStore(f *os.File) (*store, error) {
+// This method creates a Store for the given file, governed by config's
+// MaxBytes and SyncPolicy. The zero value StoreConfig{} is unbounded and
+// never fsyncs on its own, matching the store's original behavior.
+func newStore(f *os.File, config StoreConfig) (*store, error) {
 	fi, err := os.Stat(f.Name())
 	if err != nil {
 		return nil, err
@@ -32,11 +98,84 @@ func newStore(f *os.File) (*store, error) {
 	// In case we are re-creating a file with existing data we need to get the size
 	// this could happen in case we have a service restart
 	size := uint64(fi.Size())
-	return &store{
-		File: f,
-		size: size,
-		buf:  bufio.NewWriter(f),
-	}, nil
+	s := &store{
+		File:   f,
+		size:   size,
+		buf:    bufio.NewWriter(f),
+		config: config,
+	}
+
+	if config.SyncPolicy == SyncInterval && config.SyncInterval > 0 {
+		s.stopSync = make(chan struct{})
+		s.syncDone = make(chan struct{})
+		go s.runSyncTimer()
+	}
+
+	return s, nil
+}
+
+// runSyncTimer fsyncs the store every config.SyncInterval until
+// stopSyncTimer closes s.stopSync. newStore starts it only when SyncPolicy
+// is SyncInterval.
+func (s *store) runSyncTimer() {
+	defer close(s.syncDone)
+
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			_ = s.syncLocked()
+			s.mu.Unlock()
+		case <-s.stopSync:
+			return
+		}
+	}
+}
+
+// stopSyncTimer stops the background SyncInterval goroutine, if one is
+// running, and waits for it to exit. It must be called without s.mu held,
+// since the goroutine itself needs to acquire it.
+func (s *store) stopSyncTimer() {
+	if s.stopSync == nil {
+		return
+	}
+	close(s.stopSync)
+	<-s.syncDone
+}
+
+// syncLocked flushes the buffered writer and fsyncs the file. It must be
+// called with s.mu held.
+func (s *store) syncLocked() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	return s.File.Sync()
+}
+
+// flushLocked flushes the buffered writer, additionally fsyncing when
+// SyncPolicy is SyncOnFlush. It must be called with s.mu held, and is what
+// Read and friends use in place of a bare s.buf.Flush().
+func (s *store) flushLocked() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if s.config.SyncPolicy == SyncOnFlush {
+		return s.File.Sync()
+	}
+	return nil
+}
+
+// Sync flushes any buffered writes and fsyncs the underlying file,
+// regardless of SyncPolicy. Callers that need a durability guarantee at a
+// specific point -- before acknowledging a produce request, say -- can call
+// it directly instead of waiting on the configured policy.
+func (s *store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.syncLocked()
 }
 
 // This method appends the given bytes to the store. We write the length of the record
@@ -50,6 +189,10 @@ func (s *store) Append(p []byte) (n uint64, pos uint64, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.config.MaxBytes > 0 && s.size+lenWidth+uint64(len(p)) > s.config.MaxBytes {
+		return 0, 0, ErrStoreFull
+	}
+
 	pos = s.size
 	if err := binary.Write(s.buf, enc, uint64(len(p))); err != nil {
 		return 0, 0, err
@@ -62,56 +205,218 @@ func (s *store) Append(p []byte) (n uint64, pos uint64, err error) {
 
 	w += lenWidth
 	s.size += uint64(w)
+
+	if err := s.maybeSyncLocked(); err != nil {
+		return uint64(w), pos, err
+	}
+
 	return uint64(w), pos, nil
 }
 
+// maybeSyncLocked applies the SyncEveryN bookkeeping after an Append. It
+// must be called with s.mu held, and is a no-op under any other SyncPolicy.
+func (s *store) maybeSyncLocked() error {
+	if s.config.SyncPolicy != SyncEveryN || s.config.SyncEveryN <= 0 {
+		return nil
+	}
+
+	s.writesSinceSync++
+	if s.writesSinceSync < s.config.SyncEveryN {
+		return nil
+	}
+
+	s.writesSinceSync = 0
+	return s.syncLocked()
+}
+
 // This method return the record stored at the given position.
 // First it flushes the writer buffer, in case we're about to try to read a
 // record that the bufferhasn't flushed to disk yet. We find out how many bytes
 // we have to read to get the whole record, and then  we fetch and return the record.
 // The compiler allocates byte slices that don't escape the functions they're
 // declared in on the stack. A value scapes when it lives beyond the lifetime of
-// the function call -- if you return the value, for example
-func (s *store) Read(pos uint64) ([]byte, error) {
+// the function call -- if you return the value, for example.
+//
+// Read allocates its return value out of the shared bufferPool rather than
+// with a fresh make([]byte, ...) on every call, to keep record reads from
+// becoming a GC hotspot under load. It returns *[]byte, not []byte, and
+// callers are expected to pass that same pointer to Release once they're
+// done with it, so the pool can hand the buffer straight back out again
+// instead of needing to box a new one (see bufferPool.get).
+func (s *store) Read(pos uint64) (*[]byte, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := s.buf.Flush(); err != nil {
+	if err := s.flushLocked(); err != nil {
 		return nil, err
 	}
 
-	size := make([]byte, lenWidth)
-	if _, err := s.File.ReadAt(size, int64(pos)); err != nil {
+	recLen, err := s.readLenPrefixLocked(pos)
+	if err != nil {
 		return nil, err
 	}
 
-	b := make([]byte, enc.Uint64(size))
-	if _, err := s.File.ReadAt(b, int64(pos+lenWidth)); err != nil {
+	b := pool.get(recLen)
+	if _, err := s.File.ReadAt(*b, int64(pos+lenWidth)); err != nil {
+		pool.put(b)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrCorruptRecord
+		}
 		return nil, err
 	}
 
 	return b, nil
 }
 
+// readLenPrefixLocked reads and sanity-checks the length prefix at pos,
+// returning ErrCorruptRecord instead of a raw I/O error if the file ends
+// before a full length prefix, or before the record that prefix says
+// follows it -- the signature left behind by a crash that landed mid-
+// Append, after the length was written but before the record body was.
+// It must be called with s.mu held.
+func (s *store) readLenPrefixLocked(pos uint64) (uint64, error) {
+	size := pool.get(lenWidth)
+	defer pool.put(size)
+
+	if _, err := s.File.ReadAt(*size, int64(pos)); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, ErrCorruptRecord
+		}
+		return 0, err
+	}
+
+	recLen := enc.Uint64(*size)
+	if pos+lenWidth+recLen > s.size {
+		return 0, ErrCorruptRecord
+	}
+
+	return recLen, nil
+}
+
+// ReadInto reads the record stored at pos into dst, the caller-supplied
+// buffer, and returns the number of bytes copied. Like copy, it copies
+// min(len(dst), record length) bytes and returns a nil error either way: a
+// dst shorter than the record receives only its first len(dst) bytes, and
+// a dst longer than the record is filled only up to the record's end. A caller
+// that already holds a buffer -- one borrowed from the pool, say -- never
+// forces Read to allocate one on its behalf.
+func (s *store) ReadInto(pos uint64, dst []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.flushLocked(); err != nil {
+		return 0, err
+	}
+
+	recLen, err := s.readLenPrefixLocked(pos)
+	if err != nil {
+		return 0, err
+	}
+
+	n := uint64(len(dst))
+	if n > recLen {
+		n = recLen
+	}
+
+	if _, err := s.File.ReadAt(dst[:n], int64(pos+lenWidth)); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, ErrCorruptRecord
+		}
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
 // This method reads len(p) bytes into the p beginning at the off offset in the store's file.
 // It implements io.ReaderAt on the store type
 func (s *store) ReadAt(p []byte, off int64) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if err := s.buf.Flush(); err != nil {
+	if err := s.flushLocked(); err != nil {
 		return 0, err
 	}
 
 	return s.File.ReadAt(p, off)
 }
 
-// This method persists any buffered data before closing the file.
-func (s *store) Close() error {
+// ReadRangeAt reads up to n bytes of the record at pos, starting off bytes
+// into that record's payload, without reading the parts of the record the
+// caller didn't ask for. n is clamped to what's left of the record past off,
+// so a caller can ask for more than is available without it being an error --
+// the same contract byteRange applies to an already-fully-read []byte, but
+// applied at the store layer so a caller only pays for the bytes it wants
+// off disk in the first place.
+func (s *store) ReadRangeAt(pos, off, n uint64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.flushLocked(); err != nil {
+		return nil, err
+	}
+
+	recLen, err := s.readLenPrefixLocked(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	if off > recLen {
+		off = recLen
+	}
+	if rem := recLen - off; n > rem {
+		n = rem
+	}
+
+	buf := make([]byte, n)
+	if n == 0 {
+		return buf, nil
+	}
+
+	if _, err := s.File.ReadAt(buf, int64(pos+lenWidth+off)); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrCorruptRecord
+		}
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// SectionReader returns an *io.SectionReader over exactly the bytes of the
+// record at pos, letting a caller stream or seek within a single record --
+// e.g. to serve an HTTP range request -- through the standard io.Reader /
+// io.Seeker interfaces instead of reading the whole record into memory
+// first.
+func (s *store) SectionReader(pos uint64) (*io.SectionReader, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	err := s.buf.Flush()
+	if err := s.flushLocked(); err != nil {
+		return nil, err
+	}
+
+	recLen, err := s.readLenPrefixLocked(pos)
 	if err != nil {
+		return nil, err
+	}
+
+	return io.NewSectionReader(s.File, int64(pos+lenWidth), int64(recLen)), nil
+}
+
+// This method persists any buffered data, fsyncs it, and stops the
+// background sync timer (if running) before closing the file -- Close is
+// the last chance to get data to disk, so it syncs unconditionally
+// regardless of SyncPolicy.
+func (s *store) Close() error {
+	s.stopSyncTimer()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.File.Sync(); err != nil {
 		return err
 	}
 	return s.File.Close()
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"mime"
+	"strings"
+)
+
+// Codec converts between the wire bytes of an HTTP request/response body
+// and the Go values the handlers operate on. Selecting a Codec via
+// Accept/Content-Type negotiation lets handleProduce and handleConsume
+// serve both JSON (easy to curl and debug) and Protobuf (less overhead on
+// the wire) from the same handler logic.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	ContentType() string
+}
+
+var codecs = map[string]Codec{
+	jsonCodec{}.ContentType():  jsonCodec{},
+	protoCodec{}.ContentType(): protoCodec{},
+}
+
+// codecFor picks a Codec out of header, a Content-Type or Accept value.
+// header can be a single media type with parameters (e.g.
+// "application/json; charset=utf-8") or, for Accept, a comma-separated
+// list of media ranges in preference order (e.g. "application/x-protobuf,
+// */*;q=0.1"). It returns the first entry that names a registered Codec,
+// ignoring parameters along the way, and falls back to JSON -- the codec
+// every client already speaks without a schema -- if header is empty, is
+// malformed, or reaches a "*/*" wildcard before matching one.
+//
+// This doesn't implement full RFC 7231 weighting (sorting candidates by
+// their q parameter); it takes entries in the order the client listed
+// them, which is enough to stop real headers like the ones above from
+// falling back to JSON by accident.
+func codecFor(header string) Codec {
+	for _, part := range strings.Split(header, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == "*/*" {
+			break
+		}
+		if c, ok := codecs[mediaType]; ok {
+			return c
+		}
+	}
+	return jsonCodec{}
+}
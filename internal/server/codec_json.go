@@ -0,0 +1,19 @@
+package server
+
+import "encoding/json"
+
+// jsonCodec is the default Codec: human-readable, and the one every HTTP
+// client can already speak without being taught the schema first.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoCodec implements Codec for the message shapes described in
+// api/v1/record.proto. It's written directly against protowire, the same
+// low-level tag/varint primitives protoc-gen-go builds on, rather than
+// generated types, since this repo has no protoc/protoc-gen-go step in
+// its build.
+//
+// api/v1/record.proto is the source of truth for the wire format, and
+// stays that way only by convention -- there's no codegen step tying the
+// two together, so the fieldXxx constants below must be kept in sync by
+// hand with the field numbers in the .proto (which carries a matching
+// comment against each field naming the constant here). A mismatch
+// between a constant here and its field number there is a silent wire
+// format break, not a compile error.
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+const (
+	fieldRecordValue  protowire.Number = 1
+	fieldRecordOffset protowire.Number = 2
+
+	fieldProduceRequestRecord  protowire.Number = 1
+	fieldProduceResponseOffset protowire.Number = 1
+	fieldConsumeRequestOffset  protowire.Number = 1
+	fieldConsumeResponseRecord protowire.Number = 1
+)
+
+func marshalRecord(b []byte, rec Record) []byte {
+	b = protowire.AppendTag(b, fieldRecordValue, protowire.BytesType)
+	b = protowire.AppendBytes(b, rec.Value)
+	b = protowire.AppendTag(b, fieldRecordOffset, protowire.VarintType)
+	b = protowire.AppendVarint(b, rec.Offset)
+	return b
+}
+
+// forEachField walks the top-level fields of a protobuf message, handing
+// each tag and its still-encoded value to fn. fn must consume the value
+// (e.g. via protowire.Consume*) and return how many bytes it consumed.
+func forEachField(data []byte, fn func(num protowire.Number, typ protowire.Type, rest []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		consumed, err := fn(num, typ, data)
+		if err != nil {
+			return err
+		}
+		data = data[consumed:]
+	}
+	return nil
+}
+
+func skipField(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+	n := protowire.ConsumeFieldValue(num, typ, data)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	return n, nil
+}
+
+func unmarshalRecord(data []byte, rec *Record) error {
+	return forEachField(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+		switch num {
+		case fieldRecordValue:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			rec.Value = append([]byte(nil), v...)
+			return n, nil
+		case fieldRecordOffset:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			rec.Offset = v
+			return n, nil
+		default:
+			return skipField(num, typ, data)
+		}
+	})
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case ProduceRequest:
+		b := protowire.AppendTag(nil, fieldProduceRequestRecord, protowire.BytesType)
+		return protowire.AppendBytes(b, marshalRecord(nil, m.Record)), nil
+	case ProduceResponse:
+		b := protowire.AppendTag(nil, fieldProduceResponseOffset, protowire.VarintType)
+		return protowire.AppendVarint(b, m.Offset), nil
+	case ConsumeRequest:
+		b := protowire.AppendTag(nil, fieldConsumeRequestOffset, protowire.VarintType)
+		return protowire.AppendVarint(b, m.Offset), nil
+	case ConsumeResponse:
+		b := protowire.AppendTag(nil, fieldConsumeResponseRecord, protowire.BytesType)
+		return protowire.AppendBytes(b, marshalRecord(nil, m.Record)), nil
+	default:
+		return nil, fmt.Errorf("proto codec: unsupported type %T", v)
+	}
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case *ProduceRequest:
+		return forEachField(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+			if num != fieldProduceRequestRecord {
+				return skipField(num, typ, data)
+			}
+			b, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			return n, unmarshalRecord(b, &m.Record)
+		})
+	case *ProduceResponse:
+		return forEachField(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+			if num != fieldProduceResponseOffset {
+				return skipField(num, typ, data)
+			}
+			off, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			m.Offset = off
+			return n, nil
+		})
+	case *ConsumeRequest:
+		return forEachField(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+			if num != fieldConsumeRequestOffset {
+				return skipField(num, typ, data)
+			}
+			off, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			m.Offset = off
+			return n, nil
+		})
+	case *ConsumeResponse:
+		return forEachField(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+			if num != fieldConsumeResponseRecord {
+				return skipField(num, typ, data)
+			}
+			b, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			return n, unmarshalRecord(b, &m.Record)
+		})
+	default:
+		return fmt.Errorf("proto codec: unsupported type %T", v)
+	}
+}
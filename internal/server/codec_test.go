@@ -0,0 +1,142 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestJSONCodecRoundTrip checks that jsonCodec.Marshal followed by Unmarshal
+// reproduces the original value, and that it reports the content type
+// codecFor keys its registration on.
+func TestJSONCodecRoundTrip(t *testing.T) {
+	c := jsonCodec{}
+
+	if got := c.ContentType(); got != "application/json" {
+		t.Fatalf("ContentType: got %q, want %q", got, "application/json")
+	}
+
+	want := ConsumeResponse{Record: Record{Value: []byte("hello world"), Offset: 3}}
+
+	b, err := c.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got ConsumeResponse
+	if err := c.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip: got %+v, want %+v", got, want)
+	}
+}
+
+// TestProtoCodecRoundTrip checks that protoCodec.Marshal/Unmarshal round
+// trips every request/response shape it claims to support in its Marshal
+// and Unmarshal switches.
+func TestProtoCodecRoundTrip(t *testing.T) {
+	c := protoCodec{}
+
+	if got := c.ContentType(); got != "application/x-protobuf" {
+		t.Fatalf("ContentType: got %q, want %q", got, "application/x-protobuf")
+	}
+
+	rec := Record{Value: []byte("hello world"), Offset: 7}
+
+	t.Run("ProduceRequest", func(t *testing.T) {
+		want := ProduceRequest{Record: rec}
+		b, err := c.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ProduceRequest
+		if err := c.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("round trip: got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("ProduceResponse", func(t *testing.T) {
+		want := ProduceResponse{Offset: 42}
+		b, err := c.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ProduceResponse
+		if err := c.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("round trip: got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("ConsumeRequest", func(t *testing.T) {
+		want := ConsumeRequest{Offset: 9}
+		b, err := c.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ConsumeRequest
+		if err := c.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("round trip: got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("ConsumeResponse", func(t *testing.T) {
+		want := ConsumeResponse{Record: rec}
+		b, err := c.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ConsumeResponse
+		if err := c.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("round trip: got %+v, want %+v", got, want)
+		}
+	})
+
+	if _, err := c.Marshal("unsupported"); err == nil {
+		t.Fatal("Marshal: got nil error for an unsupported type, want an error")
+	}
+	if err := c.Unmarshal(nil, &struct{}{}); err == nil {
+		t.Fatal("Unmarshal: got nil error for an unsupported type, want an error")
+	}
+}
+
+// TestCodecFor checks content-type/Accept negotiation: an exact match picks
+// the named Codec, parameters are ignored, a comma-separated Accept list
+// picks the first registered entry, and anything unmatched -- including a
+// wildcard or a malformed header -- falls back to JSON.
+func TestCodecFor(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"empty falls back to json", "", "application/json"},
+		{"exact json", "application/json", "application/json"},
+		{"exact proto", "application/x-protobuf", "application/x-protobuf"},
+		{"json with charset param", "application/json; charset=utf-8", "application/json"},
+		{"accept list picks proto first", "application/x-protobuf, application/json", "application/x-protobuf"},
+		{"accept list picks json first", "application/json, application/x-protobuf", "application/json"},
+		{"wildcard falls back to json", "*/*;q=0.1", "application/json"},
+		{"unregistered type falls back to json", "application/xml", "application/json"},
+		{"malformed header falls back to json", ";;;not a media type", "application/json"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := codecFor(tc.header).ContentType(); got != tc.want {
+				t.Errorf("codecFor(%q).ContentType(): got %q, want %q", tc.header, got, tc.want)
+			}
+		})
+	}
+}
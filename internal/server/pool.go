@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQueueFull is returned by workerPool.Submit when the bounded queue is
+// already at capacity. Callers should reject the request -- e.g. with a
+// 503 and Retry-After -- rather than block waiting for a slot to free up.
+var ErrQueueFull = errors.New("worker pool: queue full")
+
+// workerPool bounds how much concurrent work handleProduce and
+// handleConsume can push onto the Log at once: a fixed number of worker
+// goroutines pull tasks off a channel buffered to a fixed depth, the same
+// "bounded queue backed by a semaphore" pattern used to cap concurrency
+// against a shared resource. Without it a burst of requests would spawn
+// unbounded goroutines that all pile up contending on store.mu.
+type workerPool struct {
+	tasks   chan func()
+	stopped sync.WaitGroup
+
+	queued   int64
+	rejected int64
+}
+
+// newWorkerPool starts workers goroutines pulling tasks off a queue
+// buffered to depth queueSize.
+func newWorkerPool(workers, queueSize int) *workerPool {
+	p := &workerPool{
+		tasks: make(chan func(), queueSize),
+	}
+	p.stopped.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+func (p *workerPool) run() {
+	defer p.stopped.Done()
+	for task := range p.tasks {
+		task()
+		atomic.AddInt64(&p.queued, -1)
+	}
+}
+
+// Stop closes the task queue and waits for every worker goroutine to drain
+// it and exit. Submit must not be called again after Stop -- sending on a
+// closed channel panics -- which holds here because Server.Run only calls
+// Stop once it's no longer accepting new requests.
+func (p *workerPool) Stop() {
+	close(p.tasks)
+	p.stopped.Wait()
+}
+
+// Submit enqueues task for a worker to run and returns immediately. It
+// returns ErrQueueFull without blocking if the queue is already full.
+func (p *workerPool) Submit(task func()) error {
+	// Count the task before sending it, so a worker that picks it up and
+	// finishes right away can't decrement queued below zero first.
+	atomic.AddInt64(&p.queued, 1)
+	select {
+	case p.tasks <- task:
+		return nil
+	default:
+		atomic.AddInt64(&p.queued, -1)
+		atomic.AddInt64(&p.rejected, 1)
+		return ErrQueueFull
+	}
+}
+
+// QueueDepth returns the number of tasks currently queued or running.
+func (p *workerPool) QueueDepth() int64 {
+	return atomic.LoadInt64(&p.queued)
+}
+
+// Rejected returns the total number of Submit calls that found the queue
+// full.
+func (p *workerPool) Rejected() int64 {
+	return atomic.LoadInt64(&p.rejected)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWorkerPoolSoak hammers a small pool with far more concurrent work
+// than it can run at once, the way a burst of produce/consume requests
+// would, and checks what a soak test is meant to catch: every task Submit
+// accepts runs exactly once, and QueueDepth settles back to zero once the
+// burst drains instead of leaking.
+func TestWorkerPoolSoak(t *testing.T) {
+	const (
+		workers      = 4
+		queueSize    = 8
+		submitters   = 50
+		perSubmitter = 20
+	)
+
+	p := newWorkerPool(workers, queueSize)
+
+	var ran, accepted int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < submitters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perSubmitter; j++ {
+				err := p.Submit(func() {
+					atomic.AddInt64(&ran, 1)
+				})
+				switch err {
+				case nil:
+					atomic.AddInt64(&accepted, 1)
+				case ErrQueueFull:
+				default:
+					t.Errorf("Submit: unexpected error %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for p.QueueDepth() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if depth := p.QueueDepth(); depth != 0 {
+		t.Fatalf("QueueDepth: got %d after drain, want 0", depth)
+	}
+	if got := atomic.LoadInt64(&ran); got != atomic.LoadInt64(&accepted) {
+		t.Fatalf("ran %d tasks, want %d (every accepted Submit should run exactly once)", got, accepted)
+	}
+	if total := atomic.LoadInt64(&accepted) + p.Rejected(); total != submitters*perSubmitter {
+		t.Fatalf("accepted+rejected = %d, want %d", total, submitters*perSubmitter)
+	}
+
+	p.Stop()
+}
+
+// TestWorkerPoolStop checks that Stop drains every worker goroutine instead
+// of leaving them blocked forever on the task channel -- the leak a graceful
+// shutdown that never called Stop would have left behind.
+func TestWorkerPoolStop(t *testing.T) {
+	const workers = 4
+
+	before := runtime.NumGoroutine()
+
+	p := newWorkerPool(workers, workers)
+
+	var ran int64
+	for i := 0; i < workers; i++ {
+		if err := p.Submit(func() { atomic.AddInt64(&ran, 1) }); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop did not return within 2s")
+	}
+
+	if got := atomic.LoadInt64(&ran); got != workers {
+		t.Fatalf("ran %d tasks before Stop returned, want %d", got, workers)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("NumGoroutine: got %d after Stop, want <= %d (pre-pool) -- worker goroutines leaked", after, before)
+	}
+}
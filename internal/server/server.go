@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/netutil"
+)
+
+// ServerConfig holds the hardening knobs applied to the HTTP server: request
+// timeouts and header size limits passed straight through to http.Server,
+// a cap on concurrent connections enforced via netutil.LimitListener, and a
+// cap on a single request body enforced via http.MaxBytesReader. Without
+// these a single slow or hostile client can hold a connection open, or a
+// request body open, indefinitely.
+// WorkerPoolSize and WorkerQueueSize additionally bound how many
+// produce/consume requests run concurrently and how many more can queue
+// behind them before handleProduce/handleConsume start rejecting requests
+// with 503 Service Unavailable.
+type ServerConfig struct {
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	MaxHeaderBytes  int
+	MaxConns        int
+	MaxRequestBytes int64
+	WorkerPoolSize  int
+	WorkerQueueSize int
+}
+
+// DefaultServerConfig returns the ServerConfig NewHTTPServer falls back to
+// when the zero value is passed: generous enough for normal use, but tight
+// enough that a slow-loris style client can't stall the server indefinitely.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		IdleTimeout:     120 * time.Second,
+		MaxHeaderBytes:  1 << 20,
+		MaxConns:        1024,
+		MaxRequestBytes: 1 << 20,
+		WorkerPoolSize:  32,
+		WorkerQueueSize: 256,
+	}
+}
+
+// Server wraps the configured *http.Server together with the Log it
+// serves and the worker pool fronting it, so Run can shut the listener
+// down, stop the pool, and drain the log on the same signal instead of
+// leaving that coordination to the caller.
+type Server struct {
+	*http.Server
+	log    *Log
+	pool   *workerPool
+	config ServerConfig
+}
+
+// This method creates and returns a fully configured *Server. It sets up the server's address (Addr),
+// a router (mux.Router), routes(HandleFunc) for handling HTTP requests (POST and GET), and applies
+// config's timeouts and header limits to the underlying http.Server.
+func NewHTTPServer(addr string, config ServerConfig) *Server {
+	if config == (ServerConfig{}) {
+		config = DefaultServerConfig()
+	}
+
+	httpsrv := newHTTPServer(config)
+	r := mux.NewRouter()
+	r.HandleFunc("/", httpsrv.handleProduce).Methods("POST")
+	r.HandleFunc("/", httpsrv.handleConsume).Methods("GET")
+	r.HandleFunc("/stream", httpsrv.handleStream).Methods("GET")
+	r.HandleFunc("/records", httpsrv.handleProduceRaw).Methods("POST")
+	r.HandleFunc("/records/{offset}", httpsrv.handleConsumeRaw).Methods("GET")
+	r.HandleFunc("/metrics", httpsrv.handleMetrics).Methods("GET")
+
+	return &Server{
+		Server: &http.Server{
+			Addr:           addr,
+			Handler:        r,
+			ReadTimeout:    config.ReadTimeout,
+			WriteTimeout:   config.WriteTimeout,
+			IdleTimeout:    config.IdleTimeout,
+			MaxHeaderBytes: config.MaxHeaderBytes,
+		},
+		log:    httpsrv.Log,
+		pool:   httpsrv.pool,
+		config: config,
+	}
+}
+
+// Run starts the server and blocks until ctx is cancelled, SIGINT or
+// SIGTERM is received, or the server fails to start. On shutdown it stops
+// accepting new connections, gives in-flight requests up to
+// config.WriteTimeout to finish via http.Server.Shutdown, stops the worker
+// pool so its goroutines exit instead of blocking on the task queue
+// forever, and then drains the Log -- flushing the store's bufio.Writer
+// and closing the file -- so a SIGTERM doesn't lose data the way killing
+// the process outright would.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if s.config.MaxConns > 0 {
+		ln = netutil.LimitListener(ln, s.config.MaxConns)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := s.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+			return
+		}
+		serveErr <- nil
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serveErr:
+		return err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.WriteTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	<-serveErr
+
+	s.pool.Stop()
+
+	return s.log.Close()
+}
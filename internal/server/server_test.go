@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// freePort asks the OS for an unused TCP port by binding to :0 and closing
+// the listener right away, so NewHTTPServer can bind the same address
+// itself without a hardcoded port that might already be taken.
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+// TestServerRunGracefulShutdown checks that cancelling Run's context makes
+// it return promptly -- well within config.WriteTimeout -- instead of
+// blocking forever, and that it stops listening on its address once it
+// does, the way a SIGTERM during normal operation should.
+func TestServerRunGracefulShutdown(t *testing.T) {
+	addr := freePort(t)
+
+	config := DefaultServerConfig()
+	config.WriteTimeout = 2 * time.Second
+
+	srv := NewHTTPServer(addr, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx) }()
+
+	// Give Run a moment to start listening before we ask it to stop.
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, 50*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("Run: got err %v, want nil", err)
+		}
+	case <-time.After(config.WriteTimeout + time.Second):
+		t.Fatal("Run did not return within WriteTimeout+1s of ctx being cancelled")
+	}
+
+	if conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond); err == nil {
+		conn.Close()
+		t.Fatal("dial succeeded after Run returned, want the listener closed")
+	}
+}
+
+// TestServerRunInvalidAddr checks that Run reports an error instead of
+// blocking when it can't bind its listener.
+func TestServerRunInvalidAddr(t *testing.T) {
+	srv := NewHTTPServer("invalid-address-with-no-port", DefaultServerConfig())
+
+	if err := srv.Run(context.Background()); err == nil {
+		t.Fatal("Run: got nil error for an unlistenable address, want an error")
+	}
+}